@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var backendName = flag.String("backend", "lxc", "Backend to use: lxc or lxd")
+var lxdRemote = flag.String("lxd-remote", "/var/lib/lxd/unix.socket", "LXD daemon to query: unix socket path or https:// URL")
+
+//
+// Backend abstracts how container names and stats are obtained, so lxc-top
+// can run against classic liblxc or an LXD daemon with no other code changes.
+type Backend interface {
+	List() ([]string, error)
+	Stat(name string) (Container, error)
+}
+
+// newBackend constructs the Backend selected by --backend.
+func newBackend(name string) (Backend, error) {
+	switch name {
+	case "lxc":
+		return LxcBackend{}, nil
+	case "lxd":
+		return NewLxdBackend(*lxdRemote), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want lxc or lxd)", name)
+	}
+}
+
+//
+// LxcBackend drives classic liblxc containers: lxc-ls for listing, and the
+// native cgroupfs/procfs reads in collector.go for stats.
+type LxcBackend struct{}
+
+func (LxcBackend) List() ([]string, error) {
+	return lxcList(), nil
+}
+
+func (LxcBackend) Stat(name string) (Container, error) {
+	stats, err := collectCgroupStats(name)
+	if err != nil {
+		return Container{}, err // Assume container is stopped
+	}
+	c := Container{Name: name, LastCheckTime: time.Now()}
+	c.Cpu = stats.CpuUsageNs
+	c.Mem = stats.MemUsage
+	c.BlkIoRead = stats.BlkioRead
+	c.BlkIoWrite = stats.BlkioWrite
+	c.NumPids = len(stats.Pids)
+	c.CpuMask = stats.CpuMask
+	c.Pids = stats.Pids
+	c.CgroupPath = stats.CgroupPath
+	c.NetIfaces = netIfaceStats(stats.Pids)
+	for _, s := range c.NetIfaces {
+		c.NetRx += s.Rx
+		c.NetTx += s.Tx
+	}
+	return c, nil
+}
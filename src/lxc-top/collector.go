@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//
+// Native cgroup/procfs collector. Reads container metrics straight from the
+// kernel instead of shelling out to lxc-info, auto-detecting cgroup v1
+// (per-controller hierarchies under /sys/fs/cgroup/<controller>/lxc/<name>)
+// vs v2 (single unified hierarchy, lxc.payload.<name> under systemd).
+
+type CgroupVersion int
+
+const (
+	CgroupUnknown CgroupVersion = iota
+	CgroupV1
+	CgroupV2
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+var cgroupVersion = detectCgroupVersion()
+
+// detectCgroupVersion is computed once at startup from the cgroupfs layout.
+func detectCgroupVersion() CgroupVersion {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return CgroupV2
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cpuacct")); err == nil {
+		return CgroupV1
+	}
+	return CgroupUnknown
+}
+
+// containerCgroupDir locates a container's cgroup directory, trying both the
+// plain cgroupfs layout lxc uses (lxc/<name>) and the systemd scope layout
+// (lxc.payload.<name>). controller is ignored under v2.
+func containerCgroupDir(controller, container string) (string, error) {
+	var candidates []string
+	if cgroupVersion == CgroupV2 {
+		candidates = []string{
+			filepath.Join(cgroupRoot, "lxc.payload."+container),
+			filepath.Join(cgroupRoot, "lxc", container),
+		}
+	} else {
+		candidates = []string{
+			filepath.Join(cgroupRoot, controller, "lxc", container),
+			filepath.Join(cgroupRoot, controller, "lxc.payload."+container),
+		}
+	}
+	for _, dir := range candidates {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no %s cgroup found for %s", controller, container)
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// readFlatKeyedFile parses "key value" lines, as used by cpu.stat and memory.stat.
+func readFlatKeyedFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		ret[fields[0]] = fields[1]
+	}
+	return ret, scanner.Err()
+}
+
+func readPids(path string) []int {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var pids []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// readBlkioV1 sums the per-device lines in blkio.io_service_bytes, e.g.
+// "253:0 Read 4096".
+func readBlkioV1(path string) (read, write uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			read += v
+		case "Write":
+			write += v
+		}
+	}
+	return
+}
+
+// readIoStatV2 sums rbytes/wbytes across devices in io.stat, e.g.
+// "253:0 rbytes=1234 wbytes=5678 rios=1 wios=1 dbytes=0 dios=0".
+func readIoStatV2(path string) (read, write uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			v, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch parts[0] {
+			case "rbytes":
+				read += v
+			case "wbytes":
+				write += v
+			}
+		}
+	}
+	return
+}
+
+// CgroupStats is the set of raw counters pulled from a container's cgroup.
+type CgroupStats struct {
+	CpuUsageNs uint64
+	MemUsage   uint64
+	BlkioRead  uint64
+	BlkioWrite uint64
+	CpuMask    string
+	Pids       []int
+	CgroupPath string
+}
+
+// collectCgroupStats reads a container's stats from cgroupfs, dispatching to
+// the v1 or v2 layout detected at startup.
+func collectCgroupStats(container string) (CgroupStats, error) {
+	if cgroupVersion == CgroupV2 {
+		return collectCgroupStatsV2(container)
+	}
+	return collectCgroupStatsV1(container)
+}
+
+func collectCgroupStatsV1(container string) (CgroupStats, error) {
+	var stats CgroupStats
+	dir, err := containerCgroupDir("cpuacct", container)
+	if err != nil {
+		return stats, err // No cgroup yet: container is stopped
+	}
+	stats.CgroupPath = dir
+	stats.CpuUsageNs, _ = readUint(filepath.Join(dir, "cpuacct.usage"))
+	stats.Pids = readPids(filepath.Join(dir, "cgroup.procs"))
+
+	if dir, err := containerCgroupDir("memory", container); err == nil {
+		stats.MemUsage, _ = readUint(filepath.Join(dir, "memory.usage_in_bytes"))
+	}
+	if dir, err := containerCgroupDir("blkio", container); err == nil {
+		stats.BlkioRead, stats.BlkioWrite = readBlkioV1(filepath.Join(dir, "blkio.io_service_bytes"))
+	}
+	if dir, err := containerCgroupDir("cpuset", container); err == nil {
+		if b, err := os.ReadFile(filepath.Join(dir, "cpuset.cpus")); err == nil {
+			stats.CpuMask = strings.TrimSpace(string(b))
+		}
+	}
+	return stats, nil
+}
+
+func collectCgroupStatsV2(container string) (CgroupStats, error) {
+	var stats CgroupStats
+	dir, err := containerCgroupDir("", container)
+	if err != nil {
+		return stats, err // No cgroup yet: container is stopped
+	}
+	stats.CgroupPath = dir
+	stats.MemUsage, _ = readUint(filepath.Join(dir, "memory.current"))
+	stats.Pids = readPids(filepath.Join(dir, "cgroup.procs"))
+	if cpuStat, err := readFlatKeyedFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		if usec, err := strconv.ParseUint(cpuStat["usage_usec"], 10, 64); err == nil {
+			stats.CpuUsageNs = usec * 1000
+		}
+	}
+	stats.BlkioRead, stats.BlkioWrite = readIoStatV2(filepath.Join(dir, "io.stat"))
+	if b, err := os.ReadFile(filepath.Join(dir, "cpuset.cpus.effective")); err == nil {
+		stats.CpuMask = strings.TrimSpace(string(b))
+	}
+	return stats, nil
+}
+
+// NetIfaceStats holds one interface's cumulative byte counters.
+type NetIfaceStats struct {
+	Rx uint64
+	Tx uint64
+}
+
+// netIfaceStats reads per-interface rx/tx byte counters (excluding loopback)
+// by reading /proc/<pid>/net/dev for one of a container's PIDs, which is
+// scoped to the container's own network namespace.
+func netIfaceStats(pids []int) map[string]NetIfaceStats {
+	for _, pid := range pids {
+		f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+		if err != nil {
+			continue
+		}
+		ifaces := make(map[string]NetIfaceStats)
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header line 1
+		scanner.Scan() // header line 2
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			iface := strings.TrimSpace(parts[0])
+			if iface == "lo" {
+				continue
+			}
+			fields := strings.Fields(parts[1])
+			if len(fields) < 9 {
+				continue
+			}
+			var s NetIfaceStats
+			if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+				s.Rx = v
+			}
+			if v, err := strconv.ParseUint(fields[8], 10, 64); err == nil {
+				s.Tx = v
+			}
+			ifaces[iface] = s
+		}
+		f.Close()
+		return ifaces
+	}
+	return nil
+}
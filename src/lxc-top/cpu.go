@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"runtime"
+)
+
+var perCpu = flag.Bool("per-cpu", false, "Show CPU% aggregated across cores (can exceed 100%) instead of normalized to total capacity")
+
+// computeCpuPct converts elapsed cgroup CPU time (elapsedCpuNs) over elapsed
+// wall-clock time (elapsedWallNs), both nanoseconds, into a percentage. By
+// default the result is normalized against total capacity (runtime.NumCPU()
+// cores == 100%); --per-cpu reports the raw aggregate instead, which can
+// exceed 100% the way classic `top -1` does on multi-core hosts.
+func computeCpuPct(elapsedCpuNs, elapsedWallNs uint64, perCpu bool) int {
+	if elapsedWallNs == 0 {
+		return 0
+	}
+	pct := elapsedCpuNs * 100 / elapsedWallNs
+	if !perCpu {
+		pct /= uint64(runtime.NumCPU())
+	}
+	return int(pct)
+}
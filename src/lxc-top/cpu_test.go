@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestComputeCpuPctPerCpu(t *testing.T) {
+	// 0.5 CPU-seconds over 1 wall-second, per-cpu (unnormalized) -- should
+	// read 50% regardless of how many cores the host has.
+	got := computeCpuPct(500000000, 1000000000, true)
+	if got != 50 {
+		t.Errorf("computeCpuPct(per-cpu) = %d, want 50", got)
+	}
+}
+
+func TestComputeCpuPctNormalized(t *testing.T) {
+	// 2 CPU-seconds over 1 wall-second is 200% raw (two full cores busy);
+	// normalized, that's divided by the host's core count.
+	const elapsedCpuNs = 2000000000
+	const elapsedWallNs = 1000000000
+	want := 200 / runtime.NumCPU()
+	got := computeCpuPct(elapsedCpuNs, elapsedWallNs, false)
+	if got != want {
+		t.Errorf("computeCpuPct(normalized) = %d, want %d", got, want)
+	}
+}
+
+func TestComputeCpuPctZeroWallTime(t *testing.T) {
+	if got := computeCpuPct(123, 0, false); got != 0 {
+		t.Errorf("computeCpuPct with zero wall time = %d, want 0", got)
+	}
+}
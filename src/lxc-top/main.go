@@ -1,23 +1,19 @@
 package main
 
 import (
-	"context"
+	"flag"
 	"fmt"
 	"github.com/nsf/termbox-go"
 	"os"
 	"os/exec"
-	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-const DELAY = 3             // Delay between runs
-const TERM_WIDTH = 80       // Display width
-const VERSION = "1.0.1"     // Version
-const LXC_INFO_TIMEOUT = 10 // Timeout in case lxc-info hangs
+const DELAY = 3         // Default delay between runs, in seconds
+const TERM_WIDTH = 80   // Display width
+const VERSION = "1.0.1" // Version
 
 // Column offsets
 const (
@@ -26,18 +22,35 @@ const (
 	OffsetMem      = 62
 )
 
-// Regexes for parsing lxc-info outpur
-var elapsedRex *regexp.Regexp = regexp.MustCompile(`CPU use: [ ]+(\d+)`)
-var memRex *regexp.Regexp = regexp.MustCompile(`Memory use: [ ]+(\d+)`)
+var interval = flag.Int("interval", DELAY, "Sampling interval, in seconds")
+
+const historySize = 60 // Samples of CPU/mem history kept per container
+
+// HistSample is one point of a container's rolling CPU/mem history.
+type HistSample struct {
+	CpuPct int
+	Mem    uint64
+}
 
 //
 // Container typre
 type Container struct {
 	Name          string
 	LastCheckTime time.Time
-	Cpu           uint64
+	Cpu           uint64 // Cumulative CPU usage, nanoseconds
 	CpuPct        int
 	Mem           uint64
+	BlkIoRead     uint64 // Cumulative bytes read via blkio
+	BlkIoWrite    uint64 // Cumulative bytes written via blkio
+	DiskUsage     uint64 // Occupied storage-pool space, a gauge (LXD backend only)
+	NetRx         uint64 // Cumulative bytes received
+	NetTx         uint64 // Cumulative bytes sent
+	NumPids       int
+	CpuMask       string
+	Pids          []int
+	CgroupPath    string
+	History       []HistSample             // Ring of the last historySize samples
+	NetIfaces     map[string]NetIfaceStats // Per-interface rx/tx, keyed by interface name
 }
 
 // Sorting
@@ -76,68 +89,68 @@ func (c *Container) MemPretty() string {
 }
 
 func main() {
+	flag.Parse()
+	backend, err := newBackend(*backendName)
+	if err != nil {
+		Fatal("%s", err.Error())
+	}
+	if _, err := backend.List(); err != nil { // Just test that we can reach the backend
+		Fatal("Unable to list containers (%s)", err.Error())
+	}
+
+	if *jsonSnapshot {
+		serveJSONSnapshot(backend, time.Duration(*interval)*time.Second)
+		return
+	}
+	if *exporterAddr != "" {
+		fmt.Printf("lxc-top exporter listening on %s\n", *exporterAddr)
+		serveExporter(backend, time.Duration(*interval)*time.Second)
+		return
+	}
+
 	fmt.Printf("lxc-top initializing...\n")
-	lxcList() // Just test that we have containers and are running as roota
-	err := termbox.Init()
+	err = termbox.Init()
 	defer termbox.Close()
 	if err != nil {
 		panic(err)
 	}
+	containers := &ContainerMap{Containers: make(map[string]Container)}
 	quitChan := make(chan bool)
-	sortChan := make(chan bool)
-	go processEvents(quitChan, sortChan)
-	go mainLoop(sortChan)
+	sortChan := make(chan UIState)
+	go processEvents(quitChan, sortChan, containers)
+	go mainLoop(sortChan, backend, containers)
 	<-quitChan
 }
 
 //
 // main loop -- get container info, sort and display, delay
-func mainLoop(sortChan chan bool) {
-	containers := &ContainerMap{Containers: make(map[string]Container)}
-	memsort := false
+func mainLoop(sortChan chan UIState, backend Backend, containers *ContainerMap) {
+	var state UIState
+	delay := time.Duration(*interval) * time.Second
 	for {
-		lxcGetAll(containers)
-		sortAndDisplay(containers, memsort)
+		lxcGetAll(containers, backend)
+		sortAndDisplay(containers, state)
 		select {
-		case memsort = <-sortChan:
-		case <-time.After(DELAY * time.Second):
-		}
-	}
-}
-
-// Termbox event poller. Handle kbd input
-func processEvents(quitChan chan bool, sortChan chan bool) {
-	memsort := false
-	for {
-		switch ev := termbox.PollEvent(); ev.Type {
-		case termbox.EventKey:
-			if ev.Ch == 'q' {
-				quitChan <- true
-			} else if ev.Ch == 's' {
-				memsort = !memsort
-				sortChan <- memsort
-			}
-
-		case termbox.EventError:
-			panic(ev.Err)
-
-		case termbox.EventInterrupt:
-			quitChan <- true
+		case state = <-sortChan:
+		case <-time.After(delay):
 		}
 	}
 }
 
 //
 // Get info for all running containers concurrently
-func lxcGetAll(containers *ContainerMap) {
-	names := lxcList()
+func lxcGetAll(containers *ContainerMap, backend Backend) {
+	names, err := backend.List()
+	if err != nil {
+		Fatal("Unable to list containers (%s)", err.Error())
+	}
 	var wg sync.WaitGroup
 	for _, name := range names {
 		wg.Add(1)
 		go func(name string) {
 			defer wg.Done()
 			if name != "" {
-				lxcInfo(name, containers)
+				updateContainer(name, containers, backend)
 			}
 		}(name)
 	}
@@ -146,17 +159,8 @@ func lxcGetAll(containers *ContainerMap) {
 
 //
 // Sort and display as many containers as display dimensions will allow
-func sortAndDisplay(c *ContainerMap, memsort bool) {
-	var containers []Container
-
-	for _, v := range c.Containers {
-		containers = append(containers, v)
-	}
-	if memsort {
-		sort.Sort(ByMem(containers))
-	} else {
-		sort.Sort(ByCpu(containers))
-	}
+func sortAndDisplay(c *ContainerMap, state UIState) {
+	containers := visibleContainers(c, state)
 
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 	defer termbox.Flush()
@@ -164,13 +168,17 @@ func sortAndDisplay(c *ContainerMap, memsort bool) {
 	_, height := termbox.Size()
 
 	cur_sort := "CPU"
-	if memsort {
+	if state.MemSort {
 		cur_sort = "MEM"
 	}
 
+	header := fmt.Sprintf("lxc-top v%s: 'q' quit, 's' sort, '/' filter, Enter detail, k/K stop/kill [%s]", VERSION, cur_sort)
+	if state.FilterText != "" {
+		header += fmt.Sprintf(" /%s/", state.FilterText)
+	}
 	tbClear(0, false)
 	tbClear(1, false)
-	tbPrint(0, 0, false, fmt.Sprintf("lxc-top v%s: 'q' to exit, 's' to toggle memory/cpu sort [%s]", VERSION, cur_sort))
+	tbPrint(0, 0, false, header)
 	tbClear(2, true)
 	tbPrint(OffsetName, 2, true, "NAME")
 	tbPrint(OffsetCpu, 2, true, "CPU %")
@@ -182,12 +190,18 @@ func sortAndDisplay(c *ContainerMap, memsort bool) {
 			break
 		}
 
-		tbClear(pos, false)
-		tbPrint(OffsetName, pos, false, container.Name)
-		tbPrint(OffsetCpu, pos, false, fmt.Sprintf("%d", container.CpuPct))
-		tbPrint(OffsetMem, pos, false, container.MemPretty())
+		reverse := i == state.Cursor
+		tbClear(pos, reverse)
+		tbPrint(OffsetName, pos, reverse, container.Name)
+		tbPrint(OffsetCpu, pos, reverse, fmt.Sprintf("%d", container.CpuPct))
+		tbPrint(OffsetMem, pos, reverse, container.MemPretty())
 	}
 
+	if state.Detail != "" {
+		if detail, ok := lookupContainer(c, state.Detail); ok {
+			drawDetailPanel(detail)
+		}
+	}
 }
 
 // List container names
@@ -207,42 +221,35 @@ func lxcList() []string {
 	return ret
 }
 
-// Get container info with a timeout. Compute cpu usage, parse me usage, etc for a sibgle container
-func lxcInfo(container string, containers *ContainerMap) {
-	// Set up our run context
-	ctx, cancel := context.WithTimeout(context.Background(), LXC_INFO_TIMEOUT*time.Second)
-	defer cancel() // The cancel should be deferred so resources are cleaned up
-	cmd := exec.CommandContext(ctx, "lxc-info", "-H", "-n", container)
-	out, err := cmd.CombinedOutput()
-	if ctx.Err() == context.DeadlineExceeded {
-		Fatal("Timed out getting lxc-info for container %s", container)
-	}
+// Fetch a single container's stats from the backend, compute its CPU% delta
+// against the previous sample, and push that sample onto its history ring.
+func updateContainer(name string, containers *ContainerMap, backend Backend) {
+	c, err := backend.Stat(name)
 	if err != nil {
-		Fatal("Unable to get lxc-info for %s (%s):\n%s", container, err.Error(), out)
-	}
-
-	res := elapsedRex.FindAllStringSubmatch(string(out), -1)
-	if len(res) == 0 {
 		return // Assume container is stopped
 	}
-	cpu_time, _ := strconv.ParseUint(res[0][1], 10, 64)
-	res = memRex.FindAllStringSubmatch(string(out), -1)
-	if len(res) == 0 {
-		Fatal("Unable to find mem use  in output:\n%s", out)
-	}
-	mem_used, _ := strconv.ParseUint(res[0][1], 10, 64)
-	c := Container{Name: container, Mem: mem_used}
-	c.LastCheckTime = time.Now()
-	c.Cpu = cpu_time
 	containers.Lock()
 	defer containers.Unlock()
-	old := containers.Containers[container]
-	if old.Name != "" {
+	old := containers.Containers[name]
+	if old.Name != "" && c.Cpu >= old.Cpu { // old.Cpu > c.Cpu means the container was restarted; treat like a first sample
 		dur := c.LastCheckTime.Sub(old.LastCheckTime)
-		elapsed_cpu := c.Cpu - old.Cpu
-		c.CpuPct = int(elapsed_cpu * 100 / uint64(dur))
+		c.CpuPct = computeCpuPct(c.Cpu-old.Cpu, uint64(dur), *perCpu)
+	}
+	c.History = append(old.History, HistSample{CpuPct: c.CpuPct, Mem: c.Mem})
+	if len(c.History) > historySize {
+		c.History = c.History[len(c.History)-historySize:]
+	}
+	containers.Containers[name] = c
+}
+
+// Stop (or force-kill) a container via lxc-stop. Best-effort: the next
+// sample will simply show the container as gone.
+func lxcStop(name string, kill bool) {
+	args := []string{"-n", name}
+	if kill {
+		args = append([]string{"-k"}, args...)
 	}
-	containers.Containers[container] = c
+	exec.Command("lxc-stop", args...).CombinedOutput()
 }
 
 // Fatal error
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeBackend serves canned Container snapshots for updateContainer tests.
+type fakeBackend struct {
+	stats map[string]Container
+}
+
+func (f fakeBackend) List() ([]string, error) { return nil, nil }
+
+func (f fakeBackend) Stat(name string) (Container, error) {
+	c, ok := f.stats[name]
+	if !ok {
+		return Container{}, fmt.Errorf("no such container: %s", name)
+	}
+	return c, nil
+}
+
+func TestUpdateContainerFirstSample(t *testing.T) {
+	containers := &ContainerMap{Containers: make(map[string]Container)}
+	backend := fakeBackend{stats: map[string]Container{
+		"c1": {Name: "c1", Cpu: 1000000000, Mem: 512, LastCheckTime: time.Now()},
+	}}
+
+	updateContainer("c1", containers, backend)
+
+	c := containers.Containers["c1"]
+	if c.CpuPct != 0 {
+		t.Errorf("first sample CpuPct = %d, want 0 (no previous sample to diff against)", c.CpuPct)
+	}
+	if len(c.History) != 1 {
+		t.Errorf("first sample History length = %d, want 1", len(c.History))
+	}
+}
+
+func TestUpdateContainerComputesDelta(t *testing.T) {
+	now := time.Now()
+	containers := &ContainerMap{Containers: map[string]Container{
+		"c1": {Name: "c1", Cpu: 1000000000, LastCheckTime: now.Add(-time.Second)},
+	}}
+	backend := fakeBackend{stats: map[string]Container{
+		"c1": {Name: "c1", Cpu: 2000000000, Mem: 512, LastCheckTime: now},
+	}}
+
+	updateContainer("c1", containers, backend)
+
+	want := computeCpuPct(1000000000, uint64(time.Second), *perCpu)
+	if got := containers.Containers["c1"].CpuPct; got != want {
+		t.Errorf("CpuPct = %d, want %d", got, want)
+	}
+}
+
+func TestUpdateContainerRestartGuard(t *testing.T) {
+	now := time.Now()
+	containers := &ContainerMap{Containers: map[string]Container{
+		// Cpu is high from a long-running prior instance of the container.
+		"c1": {Name: "c1", Cpu: 5000000000, CpuPct: 250, LastCheckTime: now.Add(-time.Second)},
+	}}
+	backend := fakeBackend{stats: map[string]Container{
+		// The container was stopped and restarted: its cgroup is fresh, so
+		// the cumulative counter is small again -- c.Cpu < old.Cpu.
+		"c1": {Name: "c1", Cpu: 100000000, Mem: 512, LastCheckTime: now},
+	}}
+
+	updateContainer("c1", containers, backend)
+
+	if got := containers.Containers["c1"].CpuPct; got != 0 {
+		t.Errorf("restarted container CpuPct = %d, want 0 (guarded instead of wrapping)", got)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//
+// UIState holds everything the display needs to know beyond the raw
+// container data: current sort mode, an optional name filter, the cursor
+// position, and which container (if any) has its detail panel open. It
+// replaces the single memsort bool and is passed whole down the sort channel.
+type UIState struct {
+	MemSort    bool
+	Filter     *regexp.Regexp
+	FilterText string
+	Cursor     int
+	Detail     string // Name of the container whose detail panel is open, "" if none
+}
+
+// visibleContainers returns the containers matching state's filter, sorted
+// per state's sort mode. Used both to render the list and to resolve which
+// container the cursor currently points at.
+func visibleContainers(c *ContainerMap, state UIState) []Container {
+	c.Lock()
+	defer c.Unlock()
+
+	var containers []Container
+	for _, v := range c.Containers {
+		if state.Filter != nil && !state.Filter.MatchString(v.Name) {
+			continue
+		}
+		containers = append(containers, v)
+	}
+	if state.MemSort {
+		sort.Sort(ByMem(containers))
+	} else {
+		sort.Sort(ByCpu(containers))
+	}
+	return containers
+}
+
+// selectedName returns the name of the container the cursor currently
+// points at, or "" if the cursor is out of range (e.g. an empty list).
+func selectedName(c *ContainerMap, state UIState) string {
+	list := visibleContainers(c, state)
+	if state.Cursor < 0 || state.Cursor >= len(list) {
+		return ""
+	}
+	return list[state.Cursor].Name
+}
+
+func lookupContainer(c *ContainerMap, name string) (Container, bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.Containers[name]
+	return v, ok
+}
+
+// Termbox event poller. Handle kbd input: sort toggle, filter, cursor
+// movement, detail drill-down, and stop/kill.
+func processEvents(quitChan chan bool, sortChan chan UIState, containers *ContainerMap) {
+	var state UIState
+	for {
+		switch ev := termbox.PollEvent(); ev.Type {
+		case termbox.EventKey:
+			switch {
+			case ev.Ch == 'q':
+				quitChan <- true
+			case ev.Ch == 's':
+				state.MemSort = !state.MemSort
+				sortChan <- state
+			case ev.Ch == '/':
+				state.FilterText = readFilterInput(state.FilterText)
+				if state.FilterText == "" {
+					state.Filter = nil
+				} else if re, err := regexp.Compile(state.FilterText); err == nil {
+					state.Filter = re
+				}
+				state.Cursor = 0
+				sortChan <- state
+			case ev.Key == termbox.KeyArrowUp:
+				if state.Cursor > 0 {
+					state.Cursor--
+				}
+				sortChan <- state
+			case ev.Key == termbox.KeyArrowDown:
+				if max := len(visibleContainers(containers, state)) - 1; state.Cursor < max {
+					state.Cursor++
+				}
+				sortChan <- state
+			case ev.Key == termbox.KeyEnter:
+				if name := selectedName(containers, state); name != "" {
+					if state.Detail == name {
+						state.Detail = ""
+					} else {
+						state.Detail = name
+					}
+					sortChan <- state
+				}
+			case ev.Key == termbox.KeyEsc:
+				state.Detail = ""
+				sortChan <- state
+			case ev.Ch == 'k':
+				if name := selectedName(containers, state); name != "" {
+					lxcStop(name, false)
+				}
+			case ev.Ch == 'K':
+				if name := selectedName(containers, state); name != "" {
+					if confirm(fmt.Sprintf("Force-kill %s? (y/N)", name)) {
+						lxcStop(name, true)
+					}
+					sortChan <- state
+				}
+			}
+
+		case termbox.EventError:
+			panic(ev.Err)
+
+		case termbox.EventInterrupt:
+			quitChan <- true
+		}
+	}
+}
+
+// readFilterInput reads a regex from the status line, character by
+// character, until Enter (accept) or Esc (clear). It blocks on
+// termbox.PollEvent, which is safe here since processEvents is the only
+// goroutine polling termbox events.
+func readFilterInput(initial string) string {
+	buf := []rune(initial)
+	for {
+		drawStatusLine("/"+string(buf), false)
+		ev := termbox.PollEvent()
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEnter:
+			return string(buf)
+		case ev.Key == termbox.KeyEsc:
+			return ""
+		case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		case ev.Ch != 0:
+			buf = append(buf, ev.Ch)
+		}
+	}
+}
+
+// confirm draws a y/N prompt on the status line and blocks for a response.
+func confirm(prompt string) bool {
+	drawStatusLine(prompt, true)
+	ev := termbox.PollEvent()
+	return ev.Type == termbox.EventKey && (ev.Ch == 'y' || ev.Ch == 'Y')
+}
+
+// drawStatusLine overwrites the top line with msg and flushes immediately,
+// for prompts that need to be visible while processEvents is blocked waiting
+// on the next keystroke.
+func drawStatusLine(msg string, reverse bool) {
+	tbClear(0, reverse)
+	tbPrint(0, 0, reverse, msg)
+	termbox.Flush()
+}
+
+//
+// Widget layer: framed panels used by the detail view.
+
+// drawFrame draws a titled box, the basic primitive framed panels are built from.
+func drawFrame(x, y, w, h int, title string) {
+	for row := 0; row < h; row++ {
+		for col := 0; col < w; col++ {
+			ch := ' '
+			switch {
+			case (row == 0 || row == h-1) && (col == 0 || col == w-1):
+				ch = '+'
+			case row == 0 || row == h-1:
+				ch = '-'
+			case col == 0 || col == w-1:
+				ch = '|'
+			}
+			termbox.SetCell(x+col, y+row, ch, termbox.ColorDefault, termbox.ColorDefault)
+		}
+	}
+	if title != "" {
+		tbPrint(x+2, y, false, title)
+	}
+}
+
+var sparkChars = []rune(" .:-=+*#%@")
+
+// sparkline renders a rolling series of CPU% samples as a single-line bar chart.
+func sparkline(history []HistSample) string {
+	if len(history) == 0 {
+		return "(no samples yet)"
+	}
+	chars := make([]rune, len(history))
+	for i, s := range history {
+		idx := s.CpuPct * (len(sparkChars) - 1) / 100
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sparkChars) {
+			idx = len(sparkChars) - 1
+		}
+		chars[i] = sparkChars[idx]
+	}
+	return string(chars)
+}
+
+// pidList formats a container's PIDs for display, truncating long lists.
+func pidList(pids []int) string {
+	if len(pids) == 0 {
+		return "(none)"
+	}
+	const maxShown = 12
+	shown := pids
+	suffix := ""
+	if len(shown) > maxShown {
+		shown = shown[:maxShown]
+		suffix = fmt.Sprintf(", +%d more", len(pids)-maxShown)
+	}
+	s := ""
+	for i, pid := range shown {
+		if i > 0 {
+			s += " "
+		}
+		s += strconv.Itoa(pid)
+	}
+	return s + suffix
+}
+
+// drawDetailPanel draws a framed panel with all of a container's parsed
+// fields, its PID list, cgroup path, and a rolling CPU history sparkline.
+func drawDetailPanel(c Container) {
+	width, height := termbox.Size()
+	w := width - 10
+	if w > 64 {
+		w = 64
+	}
+	if w < 30 {
+		w = 30
+	}
+	h := 12
+	x := (width - w) / 2
+	y := (height - h) / 2
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+
+	drawFrame(x, y, w, h, fmt.Sprintf(" %s ", c.Name))
+	row := y + 2
+	tbPrint(x+2, row, false, fmt.Sprintf("CPU: %d%%  Mem: %s", c.CpuPct, c.MemPretty()))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("BlkIO: %d read / %d write", c.BlkIoRead, c.BlkIoWrite))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("Disk usage: %d bytes", c.DiskUsage))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("Net: %d rx / %d tx", c.NetRx, c.NetTx))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("CPU mask: %s", c.CpuMask))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("PIDs (%d): %s", c.NumPids, pidList(c.Pids)))
+	row++
+	tbPrint(x+2, row, false, fmt.Sprintf("Cgroup: %s", c.CgroupPath))
+	row += 2
+	tbPrint(x+2, row, false, "CPU history: "+sparkline(c.History))
+	tbPrint(x+2, y+h-2, false, "Enter/Esc: close")
+}